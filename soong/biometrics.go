@@ -6,34 +6,354 @@ import (
     "strings"
 )
 
-func biometricsFlags(ctx android.BaseContext) []string {
-    var cflags []string
+// knownHalModules is the set of fingerprint HAL implementations this tree
+// knows how to build and probe. hal_modules entries must come from here so a
+// typo in an Android.bp file fails the build instead of silently producing a
+// HAL that never loads.
+var knownHalModules = []string{"Fpc", "Goodix", "Synaptics", "Silead"}
 
-    var config = ctx.AConfig().VendorConfig("XIAOMI_MSM8953_BIOMETRICS")
-    var halModules = strings.Split(strings.TrimSpace(config.String("HAL_MODULES")), ",")
+// biometricsHalProperties is the set of Android.bp-settable properties for a
+// msm8953_biometrics_hal module. HalModules falls back to the
+// XIAOMI_MSM8953_BIOMETRICS/HAL_MODULES vendor config var when left unset, so
+// device trees that haven't migrated to bp-level config keep building.
+type biometricsHalProperties struct {
+    // HalModules lists the fingerprint HAL implementations to probe, in
+    // order, when PreferredOrder is not set.
+    HalModules []string
+    // HalClasses optionally tags each entry in HalModules (e.g. "udfps",
+    // "capacitive"). Must be empty or match HalModules in length.
+    HalClasses []string
+    // DefaultHal names a HAL module, written to the generated header as
+    // kDefaultHal. The service does not read kDefaultHal: when none of the
+    // probed modules loads, it exits without trying DefaultHal.
+    DefaultHal *string
+    // PreferredOrder overrides the probe order of HalModules without
+    // changing the set of HAL modules that are built in.
+    PreferredOrder []string
+    // FodParams optionally names a msm8953_fod_params module whose generated
+    // fod_params.h should be made visible to this binary, for devices that
+    // ship an in-display sensor and need sensor geometry alongside the HAL
+    // probe order.
+    FodParams *string
+    // HalPrebuilts optionally lists msm8953_biometrics_prebuilt modules that
+    // provide this service's closed-source HAL .so blobs. Recorded as
+    // LOCAL_REQUIRED_MODULES so a PRODUCT_PACKAGES entry for this module
+    // alone is enough to pull the blobs into the vendor image too.
+    HalPrebuilts []string
+}
+
+func (p *biometricsHalProperties) probeOrder() []string {
+    if len(p.PreferredOrder) > 0 {
+        return p.PreferredOrder
+    }
+    return p.HalModules
+}
+
+// classFor returns the class tag for a HAL module name, looked up by its
+// position in HalModules — the order HalClasses is declared in, which is
+// independent of PreferredOrder.
+func (p *biometricsHalProperties) classFor(module string) string {
+    for i, m := range p.HalModules {
+        if m == module {
+            if i < len(p.HalClasses) {
+                return p.HalClasses[i]
+            }
+            break
+        }
+    }
+    return ""
+}
+
+// orderedClasses returns the class tag for each entry of probeOrder(), in
+// that same order, so callers can zip it against halModules() by index
+// safely even when preferred_order reshuffles HalModules relative to
+// HalClasses.
+func (p *biometricsHalProperties) orderedClasses() []string {
+    if len(p.HalClasses) == 0 {
+        return nil
+    }
+
+    order := p.probeOrder()
+    classes := make([]string, len(order))
+    for i, module := range order {
+        classes[i] = p.classFor(module)
+    }
+    return classes
+}
+
+// parseHalModulesConfig splits a raw XIAOMI_MSM8953_BIOMETRICS/HAL_MODULES
+// value ("Fpc, Goodix") into individual module names, trimming whitespace
+// and dropping empty entries. Pulled out of fillFromVendorConfig so it can
+// be table-tested without an android.LoadHookContext.
+func parseHalModulesConfig(raw string) []string {
+    var modules []string
+    for _, module := range strings.Split(raw, ",") {
+        if module = strings.TrimSpace(module); module != "" {
+            modules = append(modules, module)
+        }
+    }
+    return modules
+}
+
+func (p *biometricsHalProperties) fillFromVendorConfig(ctx android.LoadHookContext) {
+    if len(p.HalModules) > 0 {
+        return
+    }
+
+    config := ctx.AConfig().VendorConfig("XIAOMI_MSM8953_BIOMETRICS")
+    p.HalModules = parseHalModulesConfig(config.String("HAL_MODULES"))
+}
+
+func (p *biometricsHalProperties) validate(ctx android.LoadHookContext) bool {
+    if len(p.HalModules) == 0 {
+        ctx.ModuleErrorf("hal_modules must not be empty")
+        return false
+    }
+
+    seen := make(map[string]bool, len(p.HalModules))
+    for _, module := range p.HalModules {
+        if seen[module] {
+            ctx.ModuleErrorf("duplicate hal_modules entry %q", module)
+            return false
+        }
+        seen[module] = true
+
+        if !android.InList(module, knownHalModules) {
+            ctx.ModuleErrorf("unknown hal_modules entry %q, must be one of %v", module, knownHalModules)
+            return false
+        }
+    }
+
+    if len(p.HalClasses) > 0 && len(p.HalClasses) != len(p.HalModules) {
+        ctx.ModuleErrorf("hal_classes must be empty or match hal_modules in length")
+        return false
+    }
+
+    return p.validatePreferredOrder(ctx)
+}
+
+// validatePreferredOrder checks that PreferredOrder, when set, is a
+// permutation of HalModules rather than an independently-specified list —
+// every consumer of probeOrder() trusts that PreferredOrder only reshuffles
+// the already-validated HalModules set.
+func (p *biometricsHalProperties) validatePreferredOrder(ctx android.LoadHookContext) bool {
+    if len(p.PreferredOrder) == 0 {
+        return true
+    }
+
+    if len(p.PreferredOrder) != len(p.HalModules) {
+        ctx.ModuleErrorf("preferred_order must be a permutation of hal_modules (got %d entries, want %d)",
+            len(p.PreferredOrder), len(p.HalModules))
+        return false
+    }
+
+    inHalModules := make(map[string]bool, len(p.HalModules))
+    for _, module := range p.HalModules {
+        inHalModules[module] = true
+    }
+
+    seen := make(map[string]bool, len(p.PreferredOrder))
+    for _, module := range p.PreferredOrder {
+        if seen[module] {
+            ctx.ModuleErrorf("duplicate preferred_order entry %q", module)
+            return false
+        }
+        seen[module] = true
+
+        if !inHalModules[module] {
+            ctx.ModuleErrorf("preferred_order entry %q is not in hal_modules", module)
+            return false
+        }
+    }
 
-    cflags = append(cflags, "-DHAL_MODULES=\"" + strings.Join(halModules, "\", \"") + "\"")
+    return true
+}
+
+// biometricsManifestProperties configures the runtime HAL-loading manifest
+// installed alongside the service binary. Moving the probe order out of
+// -DHAL_MODULES and into a installed text file means reordering or adding a
+// HAL no longer forces a rebuild (and re-flash) of the service itself.
+type biometricsManifestProperties struct {
+    // ManifestName is the install file name for the generated manifest.
+    // Defaults to "<module_name>.conf".
+    ManifestName *string
+    // ManifestSubDir is the directory under /vendor/etc the manifest
+    // installs to. Defaults to "biometrics".
+    ManifestSubDir *string
+    // AllowRuntimeOverride is accepted in Android.bp but read neither by the
+    // build actions nor by the service: setting it does not change the
+    // generated manifest, its install location or its permissions.
+    AllowRuntimeOverride *bool
+}
+
+// biometricsHalModule wraps cc.Module so the generated header and the
+// runtime HAL-loading manifest produced from biometricsHalProperties can be
+// written out alongside the normal cc build actions, and so downstream
+// modules (msm8953_biometrics_prebuilt) have a concrete type to depend on.
+type biometricsHalModule struct {
+    *cc.Module
+
+    properties         biometricsHalProperties
+    manifestProperties biometricsManifestProperties
+
+    genHeader         android.ModuleGenPath
+    manifestPath      android.ModuleGenPath
+    installedManifest android.InstallPath
+}
+
+// halModules returns the resolved, validated probe order for this module, for
+// use by other modules in this package (e.g. AndroidMk wiring, the prebuilt
+// HAL installer).
+func (b *biometricsHalModule) halModules() []string {
+    return b.properties.probeOrder()
+}
+
+func (b *biometricsHalModule) genHeaderContents() string {
+    var sb strings.Builder
+    sb.WriteString("// Generated by msm8953_biometrics_hal. Do not edit.\n")
+    sb.WriteString("#pragma once\n\n")
+    sb.WriteString("static const char* const kHalModules[] = {\"" +
+        strings.Join(b.halModules(), "\", \"") + "\"};\n")
+    if classes := b.properties.orderedClasses(); len(classes) > 0 {
+        sb.WriteString("static const char* const kHalClasses[] = {\"" +
+            strings.Join(classes, "\", \"") + "\"};\n")
+    }
+    if b.properties.DefaultHal != nil {
+        sb.WriteString("static const char* const kDefaultHal = \"" + *b.properties.DefaultHal + "\";\n")
+    }
+    return sb.String()
+}
+
+func (b *biometricsHalModule) manifestName() string {
+    if b.manifestProperties.ManifestName != nil {
+        return *b.manifestProperties.ManifestName
+    }
+    return b.Name() + ".conf"
+}
+
+func (b *biometricsHalModule) manifestSubDir() string {
+    if b.manifestProperties.ManifestSubDir != nil {
+        return *b.manifestProperties.ManifestSubDir
+    }
+    return "biometrics"
+}
+
+// manifestContents renders one dlopen candidate per line, in probe order,
+// with its optional class tag appended. The C++ service treats the compiled
+// kHalModules list (see genHeaderContents) as a fallback for when this file
+// is missing, e.g. on a factory image that predates it.
+func (b *biometricsHalModule) manifestContents() string {
+    var sb strings.Builder
+    classes := b.properties.orderedClasses()
+    for i, module := range b.halModules() {
+        sb.WriteString(module)
+        if i < len(classes) {
+            sb.WriteString(" " + classes[i])
+        }
+        sb.WriteString("\n")
+    }
+    return sb.String()
+}
+
+func (b *biometricsHalModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+    b.Module.GenerateAndroidBuildActions(ctx)
+
+    android.WriteFileRule(ctx, b.genHeader, b.genHeaderContents())
+
+    b.manifestPath = android.PathForModuleGen(ctx, b.manifestName())
+    android.WriteFileRule(ctx, b.manifestPath, b.manifestContents())
+
+    installDir := android.PathForModuleInstall(ctx, "etc", b.manifestSubDir())
+    b.installedManifest = ctx.InstallFile(installDir, b.manifestName(), b.manifestPath)
+}
 
-    return cflags
+// biometricsFlags returns the cflags needed to force-include the generated
+// HAL modules header at the given path.
+func biometricsFlags(genHeaderPath string) []string {
+    return []string{"-include", genHeaderPath}
 }
 
-func biometricsHalBinary(ctx android.LoadHookContext) {
+func biometricsHalLoadHook(ctx android.LoadHookContext, b *biometricsHalModule) {
+    b.properties.fillFromVendorConfig(ctx)
+    if !b.properties.validate(ctx) {
+        return
+    }
+
+    b.genHeader = android.PathForModuleGen(ctx, "biometrics_hal_modules.h")
+
     type props struct {
         Target struct {
             Android struct {
-                Cflags []string
+                Cflags             []string
+                Local_include_dirs []string
             }
         }
+        Generated_headers []string
+        Srcs              []string
     }
 
     p := &props{}
-    p.Target.Android.Cflags = biometricsFlags(ctx)
+    p.Target.Android.Cflags = biometricsFlags(b.genHeader.String())
+    p.Target.Android.Local_include_dirs = []string{b.genHeader.Rel()}
+    if b.properties.FodParams != nil {
+        p.Generated_headers = []string{*b.properties.FodParams}
+    }
+    // service_main.cpp dlopens the manifest produced by manifestContents,
+    // falling back to the compiled-in kHalModules list; hal_modules.cpp is
+    // the parser/fallback logic it shares with biometrics/hal_modules_test.cpp.
+    p.Srcs = []string{"biometrics/service_main.cpp", "biometrics/hal_modules.cpp"}
     ctx.AppendProperties(p)
 }
 
+// AndroidMkEntries extends the binary's normal make output with the
+// installed manifest path and the resolved probe order, so the manifest shows
+// up under installed-files-vendor.txt and downstream init.rc/VINTF fragments
+// can reference both by make variable.
+func (b *biometricsHalModule) AndroidMkEntries() []android.AndroidMkEntries {
+    entries := b.Module.AndroidMkEntries()
+    if len(entries) == 0 || b.installedManifest == nil {
+        return entries
+    }
+
+    entries[0].ExtraEntries = append(entries[0].ExtraEntries,
+        func(ctx android.AndroidMkExtraEntriesContext, e *android.AndroidMkEntries) {
+            e.SetString("LOCAL_BIOMETRICS_HAL_MANIFEST", b.installedManifest.String())
+            e.SetString("LOCAL_BIOMETRICS_HAL_MODULES", strings.Join(b.halModules(), " "))
+        })
+    entries[0].Required = append(entries[0].Required, b.properties.HalPrebuilts...)
+    return entries
+}
+
 func biometricsHalBinaryFactory() android.Module {
     module, _ := cc.NewBinary(android.HostAndDeviceSupported)
-    newMod := module.Init()
-    android.AddLoadHook(newMod, biometricsHalBinary)
-    return newMod
+
+    b := &biometricsHalModule{Module: module}
+    b.AddProperties(&b.properties, &b.manifestProperties)
+    b.Init()
+
+    android.AddLoadHook(b, func(ctx android.LoadHookContext) {
+        biometricsHalLoadHook(ctx, b)
+    })
+
+    return b
+}
+
+// biometricsHalTestFactory registers a cc_test_host exercising
+// biometrics/hal_modules.cpp, the translation unit the fingerprint service
+// uses to turn a msm8953_hal_modules.conf manifest (or the compiled-in
+// kHalModules fallback) into a probe order. The HAL_MODULES string parsing
+// itself is covered Go-side by TestParseHalModulesConfig.
+func biometricsHalTestFactory() android.Module {
+    module := cc.TestHostFactory()
+
+    android.AddLoadHook(module, func(ctx android.LoadHookContext) {
+        type props struct {
+            Srcs []string
+        }
+        ctx.AppendProperties(&props{
+            Srcs: []string{"biometrics/hal_modules_test.cpp", "biometrics/hal_modules.cpp"},
+        })
+    })
+
+    return module
 }
@@ -0,0 +1,37 @@
+package msm8953
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestParseHalModulesConfig(t *testing.T) {
+    tests := []struct {
+        name string
+        raw  string
+        want []string
+    }{
+        {"empty", "", nil},
+        {"whitespaceOnly", "   ,  ,\t", nil},
+        {"single", "Fpc", []string{"Fpc"}},
+        {"trimsWhitespace", " Fpc ,  Goodix ", []string{"Fpc", "Goodix"}},
+        {"dropsEmptyEntries", "Fpc,,Goodix,", []string{"Fpc", "Goodix"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := parseHalModulesConfig(tt.raw)
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("parseHalModulesConfig(%q) = %#v, want %#v", tt.raw, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestBiometricsFlags(t *testing.T) {
+    got := biometricsFlags("out/soong/.intermediates/foo/gen/biometrics_hal_modules.h")
+    want := []string{"-include", "out/soong/.intermediates/foo/gen/biometrics_hal_modules.h"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("biometricsFlags() = %#v, want %#v", got, want)
+    }
+}
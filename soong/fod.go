@@ -0,0 +1,146 @@
+package msm8953
+
+import (
+    "android/soong/android"
+    "strconv"
+)
+
+// fodParamsProperties configures the in-display fingerprint sensor geometry
+// for devices in this family that ship an FOD sensor. All three coordinates
+// fall back to the XIAOMI_MSM8953_FOD vendor config namespace when unset, so
+// a device tree only needs SOONG_CONFIG_XIAOMI_MSM8953_FOD_* in BoardConfig
+// and no C++ changes to set its sensor position.
+type fodParamsProperties struct {
+    // PosX is the FOD icon's X position in display pixels.
+    PosX *int64
+    // PosY is the FOD icon's Y position in display pixels.
+    PosY *int64
+    // Size is the FOD icon's diameter in display pixels.
+    Size *int64
+    // Icon selects which FOD animation asset the HAL advertises to
+    // SystemUI. Optional; left to framework default when unset.
+    Icon *string
+    // PressType selects the sensor's press-detection behavior (e.g.
+    // "touch", "aod"). Optional; left to the HAL default when unset.
+    PressType *string
+}
+
+func (p *fodParamsProperties) fillFromVendorConfig(ctx android.LoadHookContext) {
+    config := ctx.AConfig().VendorConfig("XIAOMI_MSM8953_FOD")
+
+    if p.PosX == nil {
+        if v, ok := intFromConfig(config.String("POS_X")); ok {
+            p.PosX = &v
+        }
+    }
+    if p.PosY == nil {
+        if v, ok := intFromConfig(config.String("POS_Y")); ok {
+            p.PosY = &v
+        }
+    }
+    if p.Size == nil {
+        if v, ok := intFromConfig(config.String("SIZE")); ok {
+            p.Size = &v
+        }
+    }
+    if p.Icon == nil {
+        if v := config.String("ICON"); v != "" {
+            p.Icon = &v
+        }
+    }
+    if p.PressType == nil {
+        if v := config.String("PRESS_TYPE"); v != "" {
+            p.PressType = &v
+        }
+    }
+}
+
+func intFromConfig(s string) (int64, bool) {
+    if s == "" {
+        return 0, false
+    }
+    v, err := strconv.ParseInt(s, 10, 64)
+    if err != nil {
+        return 0, false
+    }
+    return v, true
+}
+
+func (p *fodParamsProperties) validate(ctx android.LoadHookContext) bool {
+    if p.PosX == nil || p.PosY == nil || p.Size == nil {
+        ctx.ModuleErrorf("pos_x, pos_y and size must all be set, either in Android.bp or via " +
+            "XIAOMI_MSM8953_FOD/{POS_X,POS_Y,SIZE} vendor config")
+        return false
+    }
+    if *p.Size <= 0 {
+        ctx.ModuleErrorf("size must be positive, got %d", *p.Size)
+        return false
+    }
+    return true
+}
+
+// fodParamsModule only ever produces a generated header for another module
+// to consume (via GeneratedHeaderDirs/GeneratedDeps) — it never compiles or
+// links anything of its own, so unlike biometricsHalModule it has no
+// business embedding cc.Module's binary-linking and installation behavior.
+// android.ModuleBase, the same base biometricsPrebuiltModule uses, is
+// enough.
+type fodParamsModule struct {
+    android.ModuleBase
+
+    properties fodParamsProperties
+    genHeader  android.ModuleGenPath
+    genDir     android.Path
+}
+
+func (f *fodParamsModule) genHeaderContents() string {
+    header := "// Generated by msm8953_fod_params. Do not edit.\n#pragma once\n\n"
+    header += "static const int kFodPositionX = " + strconv.FormatInt(*f.properties.PosX, 10) + ";\n"
+    header += "static const int kFodPositionY = " + strconv.FormatInt(*f.properties.PosY, 10) + ";\n"
+    header += "static const int kFodSize = " + strconv.FormatInt(*f.properties.Size, 10) + ";\n"
+    if f.properties.Icon != nil {
+        header += "static const char* const kFodIcon = \"" + *f.properties.Icon + "\";\n"
+    }
+    if f.properties.PressType != nil {
+        header += "static const char* const kFodPressType = \"" + *f.properties.PressType + "\";\n"
+    }
+    return header
+}
+
+func (f *fodParamsModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+    f.genHeader = android.PathForModuleGen(ctx, "fod_params.h")
+    f.genDir = android.PathForModuleGen(ctx)
+    android.WriteFileRule(ctx, f.genHeader, f.genHeaderContents())
+}
+
+// GeneratedHeaderDirs and GeneratedDeps satisfy the interface cc uses for
+// generated_headers dependencies, so a msm8953_biometrics_hal module can list
+// this module's name under generated_headers to pick up fod_params.h without
+// either module hardcoding the other's output path. cc turns
+// GeneratedHeaderDirs() into a -I flag for consumers, so it must be the gen
+// directory, not the header file itself — GeneratedDeps() is what carries
+// the file for the ninja dependency edge.
+func (f *fodParamsModule) GeneratedHeaderDirs() android.Paths {
+    return android.Paths{f.genDir}
+}
+
+func (f *fodParamsModule) GeneratedDeps() android.Paths {
+    return android.Paths{f.genHeader}
+}
+
+func fodParamsLoadHook(ctx android.LoadHookContext, f *fodParamsModule) {
+    f.properties.fillFromVendorConfig(ctx)
+    f.properties.validate(ctx)
+}
+
+func fodParamsFactory() android.Module {
+    f := &fodParamsModule{}
+    f.AddProperties(&f.properties)
+    android.InitAndroidModule(f)
+
+    android.AddLoadHook(f, func(ctx android.LoadHookContext) {
+        fodParamsLoadHook(ctx, f)
+    })
+
+    return f
+}
@@ -0,0 +1,138 @@
+package msm8953
+
+import (
+    "strings"
+
+    "android/soong/android"
+
+    "github.com/google/blueprint"
+    "github.com/google/blueprint/proptools"
+)
+
+// biometricsPrebuiltSrcs maps a known HAL module name (see knownHalModules)
+// to the prebuilt .so that implements it. Modeled as a named-field struct
+// rather than a Go map so each entry is independently bp-settable, matching
+// how Target.Android is keyed elsewhere in this package.
+type biometricsPrebuiltSrcs struct {
+    Fpc       *string
+    Goodix    *string
+    Synaptics *string
+    Silead    *string
+}
+
+func (s *biometricsPrebuiltSrcs) forModule(name string) (string, bool) {
+    var src *string
+    switch name {
+    case "Fpc":
+        src = s.Fpc
+    case "Goodix":
+        src = s.Goodix
+    case "Synaptics":
+        src = s.Synaptics
+    case "Silead":
+        src = s.Silead
+    }
+    if src == nil {
+        return "", false
+    }
+    return *src, true
+}
+
+type biometricsPrebuiltProperties struct {
+    // HalModule names the msm8953_biometrics_hal module whose resolved
+    // hal_modules list selects which entries of Srcs actually get
+    // installed. When unset, every entry with a src set is installed.
+    HalModule *string
+    // Srcs is the prebuilt .so to install for each HAL module this device
+    // ships as a closed-source blob.
+    Srcs biometricsPrebuiltSrcs
+    // Owner tags the module in the generated Android.mk, following the
+    // LOCAL_MODULE_OWNER convention used for proprietary blobs.
+    Owner *string
+    // Proprietary marks the installed files LOCAL_PROPRIETARY_MODULE.
+    Proprietary *bool
+    // Vendor marks the installed files LOCAL_VENDOR_MODULE, for devices
+    // that otherwise don't set Proprietary.
+    Vendor *bool
+}
+
+// biometricsPrebuiltModule installs closed-source fingerprint HAL .so blobs
+// into /vendor/lib64/hw/ under the filename hw_get_module() expects, and
+// tracks msm8953_biometrics_hal as a dependency so it only installs the
+// blobs that module actually probes for. hal_module only wires the prebuilt
+// to read the resolved probe order; list this prebuilt's own name under
+// hal_prebuilts on the msm8953_biometrics_hal module too, so the service
+// actually requires (and pulls in) the blob when it's the only thing listed
+// in PRODUCT_PACKAGES.
+type biometricsPrebuiltModule struct {
+    android.ModuleBase
+
+    properties biometricsPrebuiltProperties
+    installed  android.Paths
+}
+
+type biometricsHalDependencyTag struct {
+    blueprint.DependencyTag
+}
+
+var biometricsHalDepTag = biometricsHalDependencyTag{}
+
+func (m *biometricsPrebuiltModule) DepsMutator(ctx android.BottomUpMutatorContext) {
+    if m.properties.HalModule != nil {
+        ctx.AddDependency(ctx.Module(), biometricsHalDepTag, *m.properties.HalModule)
+    }
+}
+
+func (m *biometricsPrebuiltModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+    halModules := knownHalModules
+    if m.properties.HalModule != nil {
+        halModules = nil
+        ctx.VisitDirectDepsWithTag(biometricsHalDepTag, func(dep android.Module) {
+            if hal, ok := dep.(*biometricsHalModule); ok {
+                halModules = hal.halModules()
+            }
+        })
+        if halModules == nil {
+            ctx.ModuleErrorf("hal_module %q did not resolve to a msm8953_biometrics_hal dependency",
+                *m.properties.HalModule)
+            return
+        }
+    }
+
+    installDir := android.PathForModuleInstall(ctx, "lib64", "hw")
+    for _, name := range halModules {
+        src, ok := m.properties.Srcs.forModule(name)
+        if !ok {
+            continue
+        }
+
+        srcPath := android.PathForModuleSrc(ctx, src)
+        installName := "fingerprint." + strings.ToLower(name) + ".so"
+        m.installed = append(m.installed, ctx.InstallFile(installDir, installName, srcPath))
+    }
+}
+
+func (m *biometricsPrebuiltModule) AndroidMkEntries() []android.AndroidMkEntries {
+    return []android.AndroidMkEntries{{
+        Class: "ETC",
+        ExtraEntries: []android.AndroidMkExtraEntriesFunc{
+            func(ctx android.AndroidMkExtraEntriesContext, e *android.AndroidMkEntries) {
+                if m.properties.Owner != nil {
+                    e.SetString("LOCAL_MODULE_OWNER", *m.properties.Owner)
+                }
+                if proptools.Bool(m.properties.Proprietary) {
+                    e.SetBool("LOCAL_PROPRIETARY_MODULE", true)
+                } else if proptools.Bool(m.properties.Vendor) {
+                    e.SetBool("LOCAL_VENDOR_MODULE", true)
+                }
+            },
+        },
+    }}
+}
+
+func biometricsPrebuiltFactory() android.Module {
+    module := &biometricsPrebuiltModule{}
+    module.AddProperties(&module.properties)
+    android.InitAndroidModule(module)
+    return module
+}